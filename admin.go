@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// AdminServer exposes Prometheus metrics, health, export status, and a
+// reload trigger on a loopback-only HTTP listener, for operators and
+// orchestration systems. It is only started when Config.AdminAddr is set.
+type AdminServer struct {
+	config   *Config
+	proxy    *ProxyServer
+	exporter *ExporterManager
+	metrics  *Metrics
+	logger   *slog.Logger
+}
+
+// NewAdminServer creates an AdminServer. proxy and exporter back the
+// /api/users and /api/exports endpoints, and exporter drives /api/reload.
+func NewAdminServer(config *Config, proxy *ProxyServer, exporter *ExporterManager, metrics *Metrics, logger *slog.Logger) *AdminServer {
+	return &AdminServer{config: config, proxy: proxy, exporter: exporter, metrics: metrics, logger: logger}
+}
+
+// Start listens on Config.AdminAddr and serves until ctx is canceled. It is
+// a no-op if AdminAddr is unset. AdminAddr must resolve to a loopback
+// address: this endpoint serves unauthenticated pprof, metrics, and a
+// reload trigger, so it must never be reachable off the host.
+func (a *AdminServer) Start(ctx context.Context) error {
+	if a.config.AdminAddr == "" {
+		return nil
+	}
+
+	if err := requireLoopbackAddr(a.config.AdminAddr); err != nil {
+		return fmt.Errorf("refusing to start admin server on %s: %w", a.config.AdminAddr, err)
+	}
+
+	listener, err := net.Listen("tcp", a.config.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", a.config.AdminAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.handleHealthz)
+	mux.HandleFunc("/metrics", a.handleMetrics)
+	mux.HandleFunc("/api/exports", a.handleExports)
+	mux.HandleFunc("/api/users", a.handleUsers)
+	mux.HandleFunc("/api/reload", a.handleReload)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && ctx.Err() == nil {
+			a.logger.Error("admin server error", "error", err)
+		}
+	}()
+
+	a.logger.Info("admin server listening", "addr", a.config.AdminAddr)
+	return nil
+}
+
+func (a *AdminServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func (a *AdminServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	active := 0
+	for _, s := range a.exporter.Snapshot() {
+		if s.Active {
+			active++
+		}
+	}
+	a.metrics.SetActiveExports(active)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	a.metrics.WriteText(w)
+}
+
+func (a *AdminServer) handleExports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.exporter.Snapshot())
+}
+
+func (a *AdminServer) handleUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.proxy.Snapshot())
+}
+
+// handleReload mirrors the SIGHUP reload flow, re-reading the config file
+// and applying it to the live ExporterManager (and, indirectly, the shared
+// *Config the ProxyServer observes).
+func (a *AdminServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.exporter.reloadFromDisk(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// requireLoopbackAddr returns an error unless addr's host resolves
+// exclusively to loopback addresses, so a misconfigured AdminAddr (a bare
+// port, a LAN IP, a misread env-templated address) can't expose
+// unauthenticated pprof/reload/metrics beyond the host.
+func requireLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if host == "" {
+		return fmt.Errorf("must bind to a loopback address, e.g. 127.0.0.1:9090, not all interfaces")
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return fmt.Errorf("must bind to a loopback address, %q resolves to non-loopback %s", host, ip)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CredentialStore backs both the SOCKS5 USERNAME/PASSWORD subnegotiation
+// (RFC 1929) and HTTP Basic auth on the forward proxy listener. Credentials
+// can come from two places: inline plaintext pairs in Config.SOCKSUsers, and
+// an htpasswd-style file (one "user:bcrypthash" pair per line) referenced by
+// Config.SOCKSUserFile, which is hot-reloaded whenever its mtime changes.
+type CredentialStore struct {
+	mu       sync.RWMutex
+	inline   map[string]string // user -> plaintext password
+	hashed   map[string]string // user -> bcrypt hash, from the htpasswd file
+	filePath string
+	modTime  time.Time
+	logger   *slog.Logger
+}
+
+// NewCredentialStore builds a CredentialStore from config and, if
+// SOCKSUserFile is set, starts a background watcher that reloads it on
+// change. It returns a non-nil store even when no credentials are
+// configured; HasUsers reports whether authentication should be required.
+func NewCredentialStore(config *Config, logger *slog.Logger) (*CredentialStore, error) {
+	cs := &CredentialStore{
+		inline:   config.SOCKSUsers,
+		filePath: config.SOCKSUserFile,
+		logger:   logger,
+	}
+
+	if cs.filePath != "" {
+		if err := cs.reload(); err != nil {
+			return nil, fmt.Errorf("failed to load htpasswd file %s: %w", cs.filePath, err)
+		}
+		go cs.watch()
+	}
+
+	return cs, nil
+}
+
+// HasUsers reports whether any inline credentials or a credential file are
+// configured, which determines whether unauthenticated access should be
+// refused. A configured file counts even while it holds no entries.
+func (cs *CredentialStore) HasUsers() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return len(cs.inline) > 0 || len(cs.hashed) > 0 || cs.filePath != ""
+}
+
+// Authenticate reports whether user/pass is a valid credential.
+func (cs *CredentialStore) Authenticate(user, pass string) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if want, ok := cs.inline[user]; ok && want == pass {
+		return true
+	}
+
+	if hash, ok := cs.hashed[user]; ok {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cs *CredentialStore) watch() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(cs.filePath)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(cs.modTime) {
+			continue
+		}
+		if err := cs.reload(); err != nil {
+			cs.logger.Warn("failed to reload htpasswd file", "path", cs.filePath, "error", err)
+		}
+	}
+}
+
+func (cs *CredentialStore) reload() error {
+	f, err := os.Open(cs.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hashed := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		hashed[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	cs.hashed = hashed
+	cs.modTime = info.ModTime()
+	cs.mu.Unlock()
+
+	return nil
+}
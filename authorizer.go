@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+// Authorizer decides whether the peer on conn may use an exported port, and
+// returns a human-readable identity for audit logging. Exactly one backend
+// is active at a time; see Config's Export* fields for selection.
+type Authorizer interface {
+	Authorize(ctx context.Context, conn net.Conn, port int) (identity string, allowed bool)
+}
+
+// newAuthorizer picks an Authorizer backend from config, in order of
+// precedence: node keys, htpasswd-style user file, tailnet identity policy.
+// With none configured, it falls back to allowing everything, preserving
+// the old no-identity-check behavior.
+func newAuthorizer(config *Config, server *tsnet.Server, logger *slog.Logger) (Authorizer, error) {
+	switch {
+	case len(config.ExportNodeKeys) > 0:
+		return &staticKeyAuthorizer{server: server, keys: config.ExportNodeKeys}, nil
+	case config.ExportUserFile != "":
+		return newHtpasswdAuthorizer(server, config.ExportUserFile, logger)
+	case len(config.ExportPolicy) > 0:
+		return &tailscaleIdentityAuthorizer{server: server, policy: config.ExportPolicy, logger: logger}, nil
+	default:
+		return allowAllAuthorizer{}, nil
+	}
+}
+
+type allowAllAuthorizer struct{}
+
+func (allowAllAuthorizer) Authorize(_ context.Context, conn net.Conn, _ int) (string, bool) {
+	return conn.RemoteAddr().String(), true
+}
+
+// tailscaleIdentityAuthorizer resolves the caller's Tailscale identity via
+// LocalClient.WhoIs and grants access per Config.ExportPolicy, matching
+// either the peer's login name, one of its tags ("tag:ci"), or "*".
+type tailscaleIdentityAuthorizer struct {
+	server *tsnet.Server
+	policy []ExportPolicyRule
+	logger *slog.Logger
+}
+
+func (a *tailscaleIdentityAuthorizer) Authorize(ctx context.Context, conn net.Conn, port int) (string, bool) {
+	lc, err := a.server.LocalClient()
+	if err != nil {
+		return "unknown", false
+	}
+
+	who, err := lc.WhoIs(ctx, conn.RemoteAddr().String())
+	if err != nil {
+		a.logger.Warn("export authz: WhoIs failed", "peer", conn.RemoteAddr(), "error", err)
+		return "unknown", false
+	}
+
+	identity := who.UserProfile.LoginName
+	if identity == "" && who.Node != nil {
+		identity = who.Node.ComputedName
+	}
+
+	var tags []string
+	if who.Node != nil && who.Node.Tags != nil {
+		tags = who.Node.Tags
+	}
+
+	for _, rule := range a.policy {
+		if rule.Who == "*" || rule.Who == identity {
+			if matchesPortSpec(port, rule.Ports) {
+				return identity, true
+			}
+			continue
+		}
+		for _, tag := range tags {
+			if rule.Who == tag && matchesPortSpec(port, rule.Ports) {
+				return identity, true
+			}
+		}
+	}
+
+	return identity, false
+}
+
+// staticKeyAuthorizer pins specific machines by Tailscale node public key,
+// regardless of login name or tags.
+type staticKeyAuthorizer struct {
+	server *tsnet.Server
+	keys   map[string]string // node key -> allowed port spec
+}
+
+func (a *staticKeyAuthorizer) Authorize(ctx context.Context, conn net.Conn, port int) (string, bool) {
+	lc, err := a.server.LocalClient()
+	if err != nil {
+		return "unknown", false
+	}
+
+	who, err := lc.WhoIs(ctx, conn.RemoteAddr().String())
+	if err != nil || who.Node == nil {
+		return "unknown", false
+	}
+
+	key := who.Node.Key.String()
+	spec, ok := a.keys[key]
+	if !ok {
+		return key, false
+	}
+	return key, matchesPortSpec(port, spec)
+}
+
+// htpasswdAuthorizer gates access by looking up the caller's Tailscale login
+// name in a hot-reloaded htpasswd-style file ("user:bcrypthash:ports" per
+// line). There's no password exchange on a raw exported TCP connection, so
+// the bcrypt hash column isn't verified here. This three-field format is not
+// the two-field "user:hash" format that CredentialStore reads. Presence in
+// the file plus the associated port spec is what gates access.
+type htpasswdAuthorizer struct {
+	server *tsnet.Server
+	path   string
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	ports   map[string]string // user -> allowed port spec
+	modTime time.Time
+}
+
+func newHtpasswdAuthorizer(server *tsnet.Server, path string, logger *slog.Logger) (*htpasswdAuthorizer, error) {
+	a := &htpasswdAuthorizer{server: server, path: path, logger: logger}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	go a.watch()
+	return a, nil
+}
+
+func (a *htpasswdAuthorizer) Authorize(ctx context.Context, conn net.Conn, port int) (string, bool) {
+	lc, err := a.server.LocalClient()
+	if err != nil {
+		return "unknown", false
+	}
+
+	who, err := lc.WhoIs(ctx, conn.RemoteAddr().String())
+	if err != nil {
+		return "unknown", false
+	}
+	identity := who.UserProfile.LoginName
+
+	a.mu.RLock()
+	spec, ok := a.ports[identity]
+	a.mu.RUnlock()
+	if !ok {
+		return identity, false
+	}
+	return identity, matchesPortSpec(port, spec)
+}
+
+func (a *htpasswdAuthorizer) watch() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(a.path)
+		if err != nil || info.ModTime().Equal(a.modTime) {
+			continue
+		}
+		if err := a.reload(); err != nil {
+			a.logger.Warn("failed to reload export user file", "path", a.path, "error", err)
+		}
+	}
+}
+
+func (a *htpasswdAuthorizer) reload() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ports := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		ports[fields[0]] = fields[2]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.ports = ports
+	a.modTime = info.ModTime()
+	a.mu.Unlock()
+
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 )
 
 type Config struct {
@@ -15,6 +16,70 @@ type Config struct {
 	ExportAllowPorts string `json:"export_allow_ports"`
 	ExportDenyPorts  string `json:"export_deny_ports"`
 	ExportMax        int    `json:"export_max"`
+
+	// SOCKSUsers holds inline username/password pairs (plaintext, for small
+	// or test deployments). SOCKSUserFile, if set, points at an htpasswd-style
+	// file (bcrypt hashes, one "user:hash" pair per line) that is hot-reloaded
+	// whenever its mtime changes. If either is non-empty, unauthenticated
+	// access is refused and only USERNAME/PASSWORD (RFC 1929) is offered.
+	SOCKSUsers     map[string]string `json:"socks_users,omitempty"`
+	SOCKSUserFile  string            `json:"socks_user_file,omitempty"`
+	SOCKSUserRules map[string]string `json:"socks_user_rules,omitempty"` // user -> allowed port spec
+
+	// HTTPProxyPort, if non-zero, starts a second loopback listener that
+	// speaks HTTP/1.1 CONNECT tunneling and forward-proxy semantics, so
+	// clients that don't speak SOCKS5 can use tailproxy directly. It shares
+	// SOCKSUsers/SOCKSUserFile for Basic auth.
+	HTTPProxyPort  int    `json:"http_proxy_port,omitempty"`
+	HTTPAllowHosts string `json:"http_allow_hosts,omitempty"` // comma-separated hostname globs
+	HTTPDenyHosts  string `json:"http_deny_hosts,omitempty"`
+
+	// HealthChecks lists health-check policies for exported port ranges.
+	// The first entry whose Ports spec matches a given port applies to it;
+	// ports with no match are exported unconditionally, as before.
+	HealthChecks []HealthCheckConfig `json:"health_checks,omitempty"`
+
+	// ControlSocket is the Unix socket path used for LISTEN/CLOSE/RELOAD/
+	// SET/GET/LIST/STATUS commands. Defaults under the tsnet state directory.
+	ControlSocket string `json:"control_socket,omitempty"`
+
+	// Export authorization: exactly one backend is selected, in this order
+	// of precedence: ExportNodeKeys, ExportUserFile, ExportPolicy. If none
+	// are set, forwarded connections are not identity-checked (the prior
+	// behavior).
+	ExportPolicy   []ExportPolicyRule `json:"export_policy,omitempty"`
+	ExportNodeKeys map[string]string  `json:"export_node_keys,omitempty"` // node public key -> allowed port spec
+	ExportUserFile string             `json:"export_user_file,omitempty"` // htpasswd-style: user:bcrypthash:ports
+
+	// LogLevel is one of "debug", "info" (default), "warn", "error". If
+	// unset, Verbose being true is treated as "debug". LogFormat is "text"
+	// (default) or "json".
+	LogLevel  string `json:"log_level,omitempty"`
+	LogFormat string `json:"log_format,omitempty"`
+
+	// AdminAddr, if set, starts a loopback-only HTTP admin server (e.g.
+	// "127.0.0.1:9090") exposing /metrics, /healthz, /debug/pprof, and the
+	// JSON/reload API under /api/.
+	AdminAddr string `json:"admin_addr,omitempty"`
+}
+
+// ExportPolicyRule grants a tailnet identity (login name, "tag:foo", or "*"
+// for anyone) access to a set of exported ports.
+type ExportPolicyRule struct {
+	Who   string `json:"who"`
+	Ports string `json:"ports"`
+}
+
+// HealthCheckConfig describes how ExporterManager should probe a local
+// target before advertising it on the tailnet, and how to decide it has
+// gone unhealthy.
+type HealthCheckConfig struct {
+	Ports            string `json:"ports"`             // port spec, e.g. "8000-8100"
+	Type             string `json:"type"`              // "tcp" (default) or "http"
+	Path             string `json:"path,omitempty"`    // URL path for type "http"
+	IntervalSeconds  int    `json:"interval_seconds"`  // default 10
+	TimeoutSeconds   int    `json:"timeout_seconds"`   // default 2
+	FailureThreshold int    `json:"failure_threshold"` // default 3
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -38,6 +103,24 @@ func LoadConfig(path string) (*Config, error) {
 	if config.ExportMax == 0 {
 		config.ExportMax = 32
 	}
+	if config.ControlSocket == "" {
+		config.ControlSocket = filepath.Join(getStateDir(config.Hostname), "control.sock")
+	}
+	for i := range config.HealthChecks {
+		hc := &config.HealthChecks[i]
+		if hc.Type == "" {
+			hc.Type = "tcp"
+		}
+		if hc.IntervalSeconds == 0 {
+			hc.IntervalSeconds = 10
+		}
+		if hc.TimeoutSeconds == 0 {
+			hc.TimeoutSeconds = 2
+		}
+		if hc.FailureThreshold == 0 {
+			hc.FailureThreshold = 3
+		}
+	}
 
 	return &config, nil
 }
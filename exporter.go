@@ -5,45 +5,216 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"tailscale.com/tsnet"
 )
 
 // ExporterManager manages port exports over tsnet
 type ExporterManager struct {
-	config    *Config
-	server    *tsnet.Server
-	mu        sync.Mutex
-	exporters map[int]*portExporter // port -> exporter
-	ctx       context.Context
-	cancel    context.CancelFunc
+	config     *Config
+	server     *tsnet.Server
+	configPath string // source file for RELOAD/SET persistence; "" if none
+	authorizer Authorizer
+	logger     *slog.Logger
+	logLevel   *slog.LevelVar // shared with ProxyServer's logger; see newLogger
+	metrics    *Metrics
+	mu         sync.Mutex
+	exporters  map[int]*portExporter // port -> exporter, only while actively advertised
+	desired    map[int]int           // port -> refcount the operator wants exported, active or not
+	pendingDue map[int]time.Time     // port -> next time a pending (not-yet-active) port may be probed
+	ctx        context.Context
+	cancel     context.CancelFunc
 }
 
 type portExporter struct {
-	port      int
-	listener  net.Listener
-	refcount  int
-	ctx       context.Context
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
+	port     int
+	listener net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	hc *HealthCheckConfig // nil if no health check applies to this port
+
+	healthMu  sync.Mutex
+	healthy   bool
+	failCount int
+	nextCheck time.Time // next time this exporter's target may be probed, per hc.IntervalSeconds
+
+	// bytesIn, bytesOut, and activeConns are updated atomically from
+	// forwardConnection; lastErr records the most recent forwarding failure
+	// for the admin /api/exports endpoint.
+	bytesIn     int64
+	bytesOut    int64
+	activeConns int64
+	lastErrMu   sync.Mutex
+	lastErr     string
 }
 
-// NewExporterManager creates a new exporter manager
-func NewExporterManager(config *Config, server *tsnet.Server) *ExporterManager {
+// NewExporterManager creates a new exporter manager. configPath, if
+// non-empty, is the config file that RELOAD and SET read from / persist to.
+// metrics may be nil, in which case export activity is not instrumented.
+// levelVar, if non-nil, is the *slog.LevelVar backing the logger, shared
+// with other components (e.g. ProxyServer) so a single SetLevel call - as
+// RELOAD/SET/SIGHUP now do - adjusts logging everywhere; if nil, a LevelVar
+// private to this ExporterManager is created.
+func NewExporterManager(config *Config, server *tsnet.Server, configPath string, metrics *Metrics, levelVar *slog.LevelVar) (*ExporterManager, error) {
+	if levelVar == nil {
+		_, levelVar = newLogger(config)
+	}
+	logger := newLoggerForLevel(config, levelVar)
+
+	authorizer, err := newAuthorizer(config, server, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize export authorizer: %w", err)
+	}
+
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	return &ExporterManager{
-		config:    config,
-		server:    server,
-		exporters: make(map[int]*portExporter),
-		ctx:       ctx,
-		cancel:    cancel,
+	em := &ExporterManager{
+		config:     config,
+		server:     server,
+		configPath: configPath,
+		authorizer: authorizer,
+		logger:     logger,
+		logLevel:   levelVar,
+		metrics:    metrics,
+		exporters:  make(map[int]*portExporter),
+		desired:    make(map[int]int),
+		pendingDue: make(map[int]time.Time),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	if len(config.HealthChecks) > 0 {
+		go em.reconcileLoop()
+	}
+
+	return em, nil
+}
+
+// reconcileTick is how often reconcileLoop wakes up to check whether any
+// exporter's own HealthCheckConfig.IntervalSeconds has elapsed. It's a lower
+// bound on probe latency, not the probe cadence itself - each port is only
+// actually probed once its own interval is due (see reconcileOnce).
+const reconcileTick = 1 * time.Second
+
+// reconcileLoop periodically re-checks the health of active exporters,
+// tearing down any whose target has gone unhealthy, and retries starting
+// any desired-but-not-active port whose target has recovered.
+func (em *ExporterManager) reconcileLoop() {
+	ticker := time.NewTicker(reconcileTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-em.ctx.Done():
+			return
+		case <-ticker.C:
+			em.reconcileOnce()
+		}
+	}
+}
+
+func (em *ExporterManager) reconcileOnce() {
+	now := time.Now()
+
+	em.mu.Lock()
+	type probe struct {
+		port int
+		exp  *portExporter
+	}
+	var active []probe
+	for port, exp := range em.exporters {
+		if exp.hc == nil {
+			continue
+		}
+		exp.healthMu.Lock()
+		due := now.After(exp.nextCheck)
+		exp.healthMu.Unlock()
+		if due {
+			active = append(active, probe{port, exp})
+		}
+	}
+	var pending []int
+	for port, count := range em.desired {
+		if count <= 0 {
+			continue
+		}
+		if _, ok := em.exporters[port]; ok {
+			continue
+		}
+		if now.Before(em.pendingDue[port]) {
+			continue
+		}
+		pending = append(pending, port)
+	}
+	em.mu.Unlock()
+
+	// Probe outside the lock; health checks are network calls.
+	for _, a := range active {
+		healthy := checkHealth(a.port, a.exp.hc)
+
+		a.exp.healthMu.Lock()
+		if healthy {
+			a.exp.healthy = true
+			a.exp.failCount = 0
+		} else {
+			a.exp.failCount++
+			if a.exp.failCount >= a.exp.hc.FailureThreshold {
+				a.exp.healthy = false
+			}
+		}
+		unhealthy := !a.exp.healthy
+		a.exp.nextCheck = time.Now().Add(time.Duration(a.exp.hc.IntervalSeconds) * time.Second)
+		a.exp.healthMu.Unlock()
+
+		if unhealthy {
+			em.mu.Lock()
+			em.logger.Warn("health check failed, stopping export", "port", a.port)
+			em.stopExporter(a.port)
+			em.mu.Unlock()
+		}
+	}
+
+	for _, port := range pending {
+		em.mu.Lock()
+		allowed := em.isPortAllowed(port)
+		em.mu.Unlock()
+		if !allowed {
+			continue
+		}
+
+		hc := resolveHealthCheck(em.config, port)
+		healthy := hc == nil || checkHealth(port, hc)
+
+		em.mu.Lock()
+		if hc != nil {
+			em.pendingDue[port] = time.Now().Add(time.Duration(hc.IntervalSeconds) * time.Second)
+		}
+		if !healthy {
+			em.mu.Unlock()
+			continue
+		}
+		if em.desired[port] > 0 {
+			if _, ok := em.exporters[port]; !ok && len(em.exporters) < em.config.ExportMax {
+				if err := em.startExporter(port); err != nil {
+					em.logger.Warn("failed to resume export after health recovery", "port", port, "error", err)
+				}
+			}
+		}
+		em.mu.Unlock()
 	}
 }
 
@@ -70,9 +241,7 @@ func (em *ExporterManager) StartControlSocket(socketPath string) error {
 		return fmt.Errorf("failed to set socket permissions: %w", err)
 	}
 
-	if em.config.Verbose {
-		log.Printf("Control socket listening on %s", socketPath)
-	}
+	em.logger.Info("control socket listening", "path", socketPath)
 
 	// Accept connections in background
 	go func() {
@@ -89,9 +258,7 @@ func (em *ExporterManager) StartControlSocket(socketPath string) error {
 				if em.ctx.Err() != nil {
 					return
 				}
-				if em.config.Verbose {
-					log.Printf("Control socket accept error: %v", err)
-				}
+				em.logger.Warn("control socket accept error", "error", err)
 				continue
 			}
 
@@ -113,22 +280,58 @@ func (em *ExporterManager) handleControlConnection(conn net.Conn) {
 		}
 
 		parts := strings.Fields(line)
-		if len(parts) < 3 {
-			if em.config.Verbose {
-				log.Printf("Invalid control message: %s", line)
+		cmd := parts[0]
+
+		switch cmd {
+		case "STATUS":
+			em.handleStatus(conn)
+			continue
+		case "RELOAD":
+			if err := em.reloadFromDisk(em.ctx); err != nil {
+				fmt.Fprintf(conn, "ERR %v\n", err)
+			} else {
+				fmt.Fprintln(conn, "OK")
+			}
+			continue
+		case "LIST":
+			em.handleList(conn)
+			continue
+		case "GET":
+			if len(parts) < 2 {
+				fmt.Fprintln(conn, "ERR missing key")
+				continue
+			}
+			val, err := em.getField(parts[1])
+			if err != nil {
+				fmt.Fprintf(conn, "ERR %v\n", err)
+			} else {
+				fmt.Fprintf(conn, "%s=%s\n", parts[1], val)
+			}
+			continue
+		case "SET":
+			if len(parts) < 3 {
+				fmt.Fprintln(conn, "ERR usage: SET <key> <value>")
+				continue
+			}
+			if err := em.setField(em.ctx, parts[1], strings.Join(parts[2:], " ")); err != nil {
+				fmt.Fprintf(conn, "ERR %v\n", err)
+			} else {
+				fmt.Fprintln(conn, "OK")
 			}
 			continue
 		}
 
-		cmd := parts[0]
+		if len(parts) < 3 {
+			em.logger.Debug("invalid control message", "line", line)
+			continue
+		}
+
 		// family := parts[1] // tcp4 or tcp6
 		portStr := parts[2]
 
 		port, err := strconv.Atoi(portStr)
 		if err != nil {
-			if em.config.Verbose {
-				log.Printf("Invalid port in control message: %s", portStr)
-			}
+			em.logger.Debug("invalid port in control message", "port", portStr)
 			continue
 		}
 
@@ -138,45 +341,87 @@ func (em *ExporterManager) handleControlConnection(conn net.Conn) {
 		case "CLOSE":
 			em.handleClose(port)
 		default:
-			if em.config.Verbose {
-				log.Printf("Unknown control command: %s", cmd)
-			}
+			em.logger.Debug("unknown control command", "command", cmd)
+		}
+	}
+}
+
+// handleList writes the current value of every SET/GET-able config key to
+// conn, followed by a terminating "END" line.
+func (em *ExporterManager) handleList(conn net.Conn) {
+	for _, key := range []string{"ExportAllowPorts", "ExportDenyPorts", "ExitNode", "Verbose", "LogLevel", "ExportMax"} {
+		val, _ := em.getField(key)
+		fmt.Fprintf(conn, "%s=%s\n", key, val)
+	}
+	fmt.Fprintln(conn, "END")
+}
+
+// handleStatus writes one line per desired port - active, or pending on a
+// health check, the export allow/deny lists, or ExportMax - to conn,
+// followed by a terminating "END" line.
+func (em *ExporterManager) handleStatus(conn net.Conn) {
+	em.mu.Lock()
+	var lines []string
+	for port, exp := range em.exporters {
+		exp.healthMu.Lock()
+		healthy := exp.healthy
+		exp.healthMu.Unlock()
+		lines = append(lines, fmt.Sprintf("PORT %d ACTIVE HEALTHY=%t REFCOUNT=%d", port, healthy, em.desired[port]))
+	}
+	for port, count := range em.desired {
+		if count <= 0 {
+			continue
+		}
+		if _, ok := em.exporters[port]; ok {
+			continue
 		}
+		lines = append(lines, fmt.Sprintf("PORT %d PENDING HEALTHY=false REFCOUNT=%d", port, count))
+	}
+	em.mu.Unlock()
+
+	for _, l := range lines {
+		fmt.Fprintln(conn, l)
 	}
+	fmt.Fprintln(conn, "END")
 }
 
 func (em *ExporterManager) handleListen(port int) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
-	// Check if port is allowed
+	// Record the request in em.desired even if policy currently denies it,
+	// so a later RELOAD/SET that widens ExportAllowPorts/ExportDenyPorts can
+	// find and reopen it (see ApplyConfig), the same way a health-check
+	// recovery reopens a deferred port below.
+	em.desired[port]++
+
 	if !em.isPortAllowed(port) {
-		if em.config.Verbose {
-			log.Printf("Port %d not allowed by export policy", port)
-		}
+		em.logger.Debug("port not allowed by export policy, deferring export", "port", port, "refcount", em.desired[port])
 		return
 	}
 
 	// Check if already exported
-	if exp, exists := em.exporters[port]; exists {
-		exp.refcount++
-		if em.config.Verbose {
-			log.Printf("Port %d already exported, refcount now %d", port, exp.refcount)
-		}
+	if _, exists := em.exporters[port]; exists {
+		em.logger.Debug("port already exported", "port", port, "refcount", em.desired[port])
 		return
 	}
 
 	// Check max exports
 	if len(em.exporters) >= em.config.ExportMax {
-		if em.config.Verbose {
-			log.Printf("Cannot export port %d: max exports (%d) reached", port, em.config.ExportMax)
-		}
+		em.logger.Warn("cannot export port, max exports reached", "port", port, "max", em.config.ExportMax)
+		return
+	}
+
+	// If a health check applies to this port, only advertise it once the
+	// target is healthy; otherwise it stays in em.desired and reconcileLoop
+	// retries it as the target recovers.
+	if hc := resolveHealthCheck(em.config, port); hc != nil && !checkHealth(port, hc) {
+		em.logger.Debug("export target not healthy yet, deferring export", "port", port)
 		return
 	}
 
-	// Create new exporter
 	if err := em.startExporter(port); err != nil {
-		log.Printf("Failed to export port %d: %v", port, err)
+		em.logger.Error("failed to export port", "port", port, "error", err)
 	}
 }
 
@@ -184,17 +429,15 @@ func (em *ExporterManager) handleClose(port int) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
-	exp, exists := em.exporters[port]
-	if !exists {
+	if em.desired[port] <= 0 {
 		return
 	}
 
-	exp.refcount--
-	if em.config.Verbose {
-		log.Printf("Port %d refcount decreased to %d", port, exp.refcount)
-	}
+	em.desired[port]--
+	em.logger.Debug("export refcount decreased", "port", port, "refcount", em.desired[port])
 
-	if exp.refcount <= 0 {
+	if em.desired[port] <= 0 {
+		delete(em.desired, port)
 		em.stopExporter(port)
 	}
 }
@@ -210,16 +453,15 @@ func (em *ExporterManager) startExporter(port int) error {
 	exp := &portExporter{
 		port:     port,
 		listener: listener,
-		refcount: 1,
 		ctx:      ctx,
 		cancel:   cancel,
+		hc:       resolveHealthCheck(em.config, port),
+		healthy:  true,
 	}
 
 	em.exporters[port] = exp
 
-	if em.config.Verbose {
-		log.Printf("Exporting port %d on tailnet", port)
-	}
+	em.logger.Info("exporting port on tailnet", "port", port)
 
 	// Start accept loop
 	exp.wg.Add(1)
@@ -231,15 +473,16 @@ func (em *ExporterManager) startExporter(port int) error {
 	return nil
 }
 
+// stopExporter tears down the active tailnet listener for port, if any, but
+// leaves em.desired untouched so a later health recovery (or explicit LISTEN)
+// can bring it back.
 func (em *ExporterManager) stopExporter(port int) {
 	exp, exists := em.exporters[port]
 	if !exists {
 		return
 	}
 
-	if em.config.Verbose {
-		log.Printf("Stopping export of port %d", port)
-	}
+	em.logger.Info("stopping export", "port", port)
 
 	exp.cancel()
 	exp.listener.Close()
@@ -256,100 +499,104 @@ func (em *ExporterManager) acceptLoop(exp *portExporter) {
 			if exp.ctx.Err() != nil {
 				return
 			}
-			if em.config.Verbose {
-				log.Printf("Accept error on port %d: %v", exp.port, err)
-			}
+			em.logger.Warn("accept error", "port", exp.port, "error", err)
 			continue
 		}
 
-		go em.forwardConnection(exp.ctx, conn, exp.port)
+		go em.forwardConnection(exp, conn)
 	}
 }
 
-func (em *ExporterManager) forwardConnection(ctx context.Context, tsConn net.Conn, port int) {
+// setLastErr records msg as exp's most recent forwarding failure, surfaced
+// via the admin /api/exports endpoint.
+func (exp *portExporter) setLastErr(msg string) {
+	exp.lastErrMu.Lock()
+	exp.lastErr = msg
+	exp.lastErrMu.Unlock()
+}
+
+func (em *ExporterManager) forwardConnection(exp *portExporter, tsConn net.Conn) {
 	defer tsConn.Close()
 
+	port := exp.port
+	start := time.Now()
+	trace := newTraceID()
+	logger := em.logger.With("trace", trace, "port", port)
+
+	identity, allowed := em.authorizer.Authorize(exp.ctx, tsConn, port)
+	if !allowed {
+		logger.Warn("denying access: not authorized", "peer", identity)
+		em.metrics.RecordConnection("export", "denied")
+		if tc, ok := tsConn.(*net.TCPConn); ok {
+			tc.SetLinger(0) // force an RST instead of a clean FIN
+		}
+		return
+	}
+	logger = logger.With("peer", identity)
+
 	// Try IPv4 loopback first
 	localConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
 	if err != nil {
 		// Try IPv6 loopback
 		localConn, err = net.Dial("tcp", fmt.Sprintf("[::1]:%d", port))
 		if err != nil {
-			if em.config.Verbose {
-				log.Printf("Failed to connect to local port %d: %v", port, err)
-			}
+			logger.Warn("failed to connect to local target", "error", err)
+			exp.setLastErr(err.Error())
+			em.metrics.RecordConnection("export", "error")
 			return
 		}
 	}
 	defer localConn.Close()
 
-	if em.config.Verbose {
-		log.Printf("Forwarding connection to local port %d", port)
-	}
+	logger.Debug("forwarding connection to local target")
+	atomic.AddInt64(&exp.activeConns, 1)
+	defer atomic.AddInt64(&exp.activeConns, -1)
 
 	// Bidirectional copy
 	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		io.Copy(localConn, tsConn)
+		bytesIn, _ = io.Copy(localConn, tsConn)
 		localConn.(*net.TCPConn).CloseWrite()
 	}()
 
 	go func() {
 		defer wg.Done()
-		io.Copy(tsConn, localConn)
+		bytesOut, _ = io.Copy(tsConn, localConn)
 		tsConn.(*net.TCPConn).CloseWrite()
 	}()
 
 	wg.Wait()
+
+	atomic.AddInt64(&exp.bytesIn, bytesIn)
+	atomic.AddInt64(&exp.bytesOut, bytesOut)
+	em.metrics.RecordConnection("export", "ok")
+	em.metrics.ObserveConnection(time.Since(start).Seconds(), bytesIn, bytesOut)
+
+	logger.Debug("connection closed",
+		"bytes_in", bytesIn, "bytes_out", bytesOut, "duration", time.Since(start))
 }
 
 func (em *ExporterManager) isPortAllowed(port int) bool {
 	// Check deny list first
 	if em.config.ExportDenyPorts != "" {
-		if em.matchesPortSpec(port, em.config.ExportDenyPorts) {
+		if matchesPortSpec(port, em.config.ExportDenyPorts) {
 			return false
 		}
 	}
 
 	// Check allow list (if specified)
 	if em.config.ExportAllowPorts != "" {
-		return em.matchesPortSpec(port, em.config.ExportAllowPorts)
+		return matchesPortSpec(port, em.config.ExportAllowPorts)
 	}
 
 	// No allow list specified, allow by default (subject to deny list)
 	return true
 }
 
-func (em *ExporterManager) matchesPortSpec(port int, spec string) bool {
-	parts := strings.Split(spec, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-
-		// Check for range
-		if strings.Contains(part, "-") {
-			rangeParts := strings.Split(part, "-")
-			if len(rangeParts) != 2 {
-				continue
-			}
-			start, err1 := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
-			end, err2 := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
-			if err1 == nil && err2 == nil && port >= start && port <= end {
-				return true
-			}
-		} else {
-			// Single port
-			p, err := strconv.Atoi(part)
-			if err == nil && p == port {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 // Stop stops all exporters and the control socket
 func (em *ExporterManager) Stop() {
 	em.cancel()
@@ -361,3 +608,53 @@ func (em *ExporterManager) Stop() {
 		em.stopExporter(port)
 	}
 }
+
+// ExportStatus is the JSON-serializable snapshot of one exported port,
+// returned by Snapshot and served from the admin /api/exports endpoint.
+type ExportStatus struct {
+	Port        int    `json:"port"`
+	Active      bool   `json:"active"`
+	Healthy     bool   `json:"healthy"`
+	Refcount    int    `json:"refcount"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
+	ActiveConns int64  `json:"active_conns"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// Snapshot returns the current status of every desired or active export.
+func (em *ExporterManager) Snapshot() []ExportStatus {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	out := make([]ExportStatus, 0, len(em.exporters)+len(em.desired))
+	for port, exp := range em.exporters {
+		exp.healthMu.Lock()
+		healthy := exp.healthy
+		exp.healthMu.Unlock()
+		exp.lastErrMu.Lock()
+		lastErr := exp.lastErr
+		exp.lastErrMu.Unlock()
+
+		out = append(out, ExportStatus{
+			Port:        port,
+			Active:      true,
+			Healthy:     healthy,
+			Refcount:    em.desired[port],
+			BytesIn:     atomic.LoadInt64(&exp.bytesIn),
+			BytesOut:    atomic.LoadInt64(&exp.bytesOut),
+			ActiveConns: atomic.LoadInt64(&exp.activeConns),
+			LastError:   lastErr,
+		})
+	}
+	for port, count := range em.desired {
+		if count <= 0 {
+			continue
+		}
+		if _, ok := em.exporters[port]; ok {
+			continue
+		}
+		out = append(out, ExportStatus{Port: port, Active: false, Refcount: count})
+	}
+	return out
+}
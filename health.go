@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// resolveHealthCheck returns the first HealthCheckConfig whose Ports spec
+// covers port, or nil if none apply (in which case the port is exported
+// unconditionally).
+func resolveHealthCheck(config *Config, port int) *HealthCheckConfig {
+	for i := range config.HealthChecks {
+		hc := &config.HealthChecks[i]
+		if matchesPortSpec(port, hc.Ports) {
+			return hc
+		}
+	}
+	return nil
+}
+
+// checkHealth probes the local target for port according to hc and reports
+// whether it's healthy.
+func checkHealth(port int, hc *HealthCheckConfig) bool {
+	timeout := time.Duration(hc.TimeoutSeconds) * time.Second
+
+	if hc.Type == "http" {
+		client := &http.Client{Timeout: timeout}
+		url := fmt.Sprintf("http://127.0.0.1:%d%s", port, hc.Path)
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode < 400
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// startHTTPProxy starts the HTTP CONNECT / forward-proxy listener on
+// Config.HTTPProxyPort. It shares the SOCKS5 credential store for Basic
+// auth and p.server.Dial for outbound connections, so every flow - SOCKS5
+// or HTTP - goes through the same tailnet path.
+func (p *ProxyServer) startHTTPProxy(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", p.config.HTTPProxyPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	p.logger.Info("HTTP proxy listening", "addr", fmt.Sprintf("127.0.0.1:%d", p.config.HTTPProxyPort))
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.serveHTTPProxy(ctx, w, r)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && ctx.Err() == nil {
+			p.logger.Error("HTTP proxy server error", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (p *ProxyServer) serveHTTPProxy(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	trace := newTraceID()
+	logger := p.logger.With("trace", trace, "peer", r.RemoteAddr)
+
+	user, ok := p.authenticateHTTPRequest(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="tailproxy"`)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	if user != "" {
+		logger = logger.With("user", user)
+	}
+	p.recordConnection(user)
+
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		} else {
+			host = r.Host
+		}
+	}
+	if !p.hostAllowed(host) {
+		logger.Debug("HTTP proxy: host denied by policy", "host", host)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	start := time.Now()
+	if r.Method == http.MethodConnect {
+		p.handleHTTPConnect(ctx, logger, w, r)
+	} else {
+		p.handleHTTPForward(ctx, logger, w, r)
+	}
+	logger.Debug("HTTP proxy request done", "target", r.Host, "duration", time.Since(start))
+}
+
+// authenticateHTTPRequest validates the Proxy-Authorization header against
+// the shared credential store. When no credentials are configured, every
+// request is allowed through as anonymous.
+func (p *ProxyServer) authenticateHTTPRequest(r *http.Request) (string, bool) {
+	if !p.creds.HasUsers() {
+		return "", true
+	}
+
+	user, pass, ok := parseProxyBasicAuth(r.Header.Get("Proxy-Authorization"))
+	if !ok || !p.creds.Authenticate(user, pass) {
+		return "", false
+	}
+	return user, true
+}
+
+func parseProxyBasicAuth(header string) (string, string, bool) {
+	const prefix = "Basic "
+	if !strings.HasPrefix(header, prefix) {
+		return "", "", false
+	}
+	req := &http.Request{Header: http.Header{"Authorization": []string{header}}}
+	return req.BasicAuth()
+}
+
+// hostAllowed applies Config.HTTPAllowHosts/HTTPDenyHosts to host.
+func (p *ProxyServer) hostAllowed(host string) bool {
+	if p.config.HTTPDenyHosts != "" && matchesHostSpec(host, p.config.HTTPDenyHosts) {
+		return false
+	}
+	if p.config.HTTPAllowHosts != "" {
+		return matchesHostSpec(host, p.config.HTTPAllowHosts)
+	}
+	return true
+}
+
+// handleHTTPConnect tunnels a CONNECT request through the tailnet, injecting
+// X-Forwarded-* style bookkeeping into the logs the way a transparent proxy
+// would.
+func (p *ProxyServer) handleHTTPConnect(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	logger.Debug("HTTP CONNECT", "target", r.Host)
+
+	remoteConn, err := p.server.Dial(ctx, "tcp", r.Host)
+	if err != nil {
+		logger.Warn("HTTP CONNECT: failed to dial target", "target", r.Host, "error", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer remoteConn.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer clientConn.Close()
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(remoteConn, buf)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(clientConn, remoteConn)
+	}()
+	wg.Wait()
+}
+
+// handleHTTPForward proxies a plain (non-CONNECT) HTTP request, rewriting
+// X-Forwarded-* headers the way a forward proxy is expected to.
+func (p *ProxyServer) handleHTTPForward(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	if !r.URL.IsAbs() {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	outReq := r.Clone(ctx)
+	outReq.RequestURI = ""
+	outReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
+	outReq.Header.Set("X-Forwarded-Proto", "http")
+	outReq.Header.Set("X-Forwarded-Host", r.Host)
+	outReq.Header.Del("Proxy-Authorization")
+	outReq.Header.Del("Proxy-Connection")
+
+	transport := &http.Transport{DialContext: p.server.Dial}
+	resp, err := transport.RoundTrip(outReq)
+	if err != nil {
+		logger.Warn("HTTP forward: request failed", "target", r.Host, "error", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// newLogger builds the structured logger for Config.LogLevel/LogFormat,
+// defaulting to info/text. Verbose, kept for backward compatibility with
+// existing configs, is treated as equivalent to LogLevel "debug" when
+// LogLevel isn't set explicitly. The returned *slog.LevelVar lets the level
+// be adjusted later - by RELOAD/SET/SIGHUP - without rebuilding the logger.
+func newLogger(config *Config) (*slog.Logger, *slog.LevelVar) {
+	levelVar := new(slog.LevelVar)
+	levelVar.Set(resolveLogLevel(config))
+	return newLoggerForLevel(config, levelVar), levelVar
+}
+
+// newLoggerForLevel builds a logger backed by an existing *slog.LevelVar, so
+// multiple components (ProxyServer, ExporterManager) can share one level
+// that a single SetLevel call adjusts for all of them at once.
+func newLoggerForLevel(config *Config, levelVar *slog.LevelVar) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: levelVar}
+
+	var handler slog.Handler
+	if config.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	return slog.New(handler)
+}
+
+// resolveLogLevel computes the effective slog.Level for config's
+// LogLevel/Verbose fields.
+func resolveLogLevel(config *Config) slog.Level {
+	level := config.LogLevel
+	if level == "" {
+		if config.Verbose {
+			level = "debug"
+		} else {
+			level = "info"
+		}
+	}
+	return parseLogLevel(level)
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// newTraceID returns a short random identifier used to correlate every log
+// line belonging to a single connection/flow.
+func newTraceID() string {
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(buf[:])
+}
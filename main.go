@@ -75,6 +75,9 @@ func main() {
 		config.AuthKey = *authKey
 	}
 
+	logger, levelVar := newLogger(config)
+	metrics := NewMetrics()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -83,12 +86,12 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		log.Println("Received interrupt signal, shutting down...")
+		logger.Info("received interrupt signal, shutting down")
 		cancel()
 	}()
 
 	// Start the proxy server
-	proxy, err := NewProxyServer(config)
+	proxy, err := NewProxyServer(config, metrics, levelVar)
 	if err != nil {
 		log.Fatalf("Failed to create proxy server: %v", err)
 	}
@@ -107,6 +110,44 @@ func main() {
 		// Proxy is ready
 	}
 
+	// Start the exporter manager and its control socket, so LD_PRELOAD
+	// shims and operators can export ports and reconfigure at runtime.
+	if config.ControlSocket == "" {
+		config.ControlSocket = filepath.Join(getStateDir(config.Hostname), "control.sock")
+	}
+	exporterMgr, err := NewExporterManager(config, proxy.TSNetServer(), *configFile, metrics, levelVar)
+	if err != nil {
+		log.Fatalf("Failed to create exporter manager: %v", err)
+	}
+	if err := exporterMgr.StartControlSocket(config.ControlSocket); err != nil {
+		log.Fatalf("Failed to start control socket: %v", err)
+	}
+	defer exporterMgr.Stop()
+
+	// Admin server is a no-op unless Config.AdminAddr is set.
+	admin := NewAdminServer(config, proxy, exporterMgr, metrics, logger)
+	if err := admin.Start(ctx); err != nil {
+		log.Fatalf("Failed to start admin server: %v", err)
+	}
+
+	// SIGHUP triggers a live reload of the config file (if one is in use),
+	// applying exit-node, export-policy, and logging changes without a
+	// restart.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if *configFile == "" {
+				logger.Warn("received SIGHUP but no -config file was given, ignoring")
+				continue
+			}
+			logger.Info("received SIGHUP, reloading configuration")
+			if err := exporterMgr.reloadFromDisk(ctx); err != nil {
+				logger.Error("reload failed", "error", err)
+			}
+		}
+	}()
+
 	if proxyOnly {
 		// Proxy-only mode: just wait for interrupt
 		fmt.Fprintf(os.Stderr, "SOCKS5 proxy running on 127.0.0.1:%d\n", config.ProxyPort)
@@ -123,12 +164,10 @@ func main() {
 		select {
 		case err := <-proxyChan:
 			if err != nil && err != context.Canceled {
-				log.Printf("Proxy server error: %v", err)
+				logger.Error("proxy server error", "error", err)
 			}
 		case <-time.After(2 * time.Second):
-			if config.Verbose {
-				log.Println("Timeout waiting for proxy to stop")
-			}
+			logger.Debug("timeout waiting for proxy to stop")
 		}
 		return
 	}
@@ -167,11 +206,7 @@ func main() {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if config.Verbose {
-		log.Printf("Executing command: %v", flag.Args())
-		log.Printf("LD_PRELOAD: %s", preloadLib)
-		log.Printf("Proxy configured on 127.0.0.1:%d", config.ProxyPort)
-	}
+	logger.Debug("executing command", "args", flag.Args(), "ld_preload", preloadLib, "proxy_addr", fmt.Sprintf("127.0.0.1:%d", config.ProxyPort))
 
 	cmdErr := cmd.Run()
 
@@ -182,12 +217,10 @@ func main() {
 	select {
 	case err := <-proxyChan:
 		if err != nil && err != context.Canceled {
-			log.Printf("Proxy server error: %v", err)
+			logger.Error("proxy server error", "error", err)
 		}
 	case <-time.After(2 * time.Second):
-		if config.Verbose {
-			log.Println("Timeout waiting for proxy to stop")
-		}
+		logger.Debug("timeout waiting for proxy to stop")
 	}
 
 	if cmdErr != nil {
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Metrics accumulates counters and histograms shared by ProxyServer and
+// ExporterManager, rendered in Prometheus text exposition format by
+// AdminServer's /metrics handler.
+type Metrics struct {
+	mu            sync.Mutex
+	connections   map[connKey]int64
+	duration      *histogram
+	bytesCopied   *histogram
+	activeExports int64
+}
+
+type connKey struct {
+	direction string // "socks5" or "export"
+	result    string // "ok", "denied", "error"
+}
+
+// NewMetrics returns an empty Metrics ready to be shared across components.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		connections: make(map[connKey]int64),
+		duration:    newHistogram([]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 30, 120}),
+		bytesCopied: newHistogram([]float64{1024, 16384, 262144, 1 << 20, 16 << 20, 256 << 20}),
+	}
+}
+
+// RecordConnection increments the connections_total counter for a
+// direction/result pair.
+func (m *Metrics) RecordConnection(direction, result string) {
+	m.mu.Lock()
+	m.connections[connKey{direction, result}]++
+	m.mu.Unlock()
+}
+
+// ObserveConnection records the duration and total bytes copied for a
+// completed connection.
+func (m *Metrics) ObserveConnection(durationSeconds float64, bytesIn, bytesOut int64) {
+	m.duration.observe(durationSeconds)
+	m.bytesCopied.observe(float64(bytesIn + bytesOut))
+}
+
+// SetActiveExports sets the current count of actively advertised exports.
+func (m *Metrics) SetActiveExports(n int) {
+	m.mu.Lock()
+	m.activeExports = int64(n)
+	m.mu.Unlock()
+}
+
+// WriteText renders every metric in Prometheus text exposition format.
+func (m *Metrics) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP tailproxy_connections_total Total connections handled, by direction and result.")
+	fmt.Fprintln(w, "# TYPE tailproxy_connections_total counter")
+	keys := make([]connKey, 0, len(m.connections))
+	for k := range m.connections {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].direction != keys[j].direction {
+			return keys[i].direction < keys[j].direction
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "tailproxy_connections_total{direction=%q,result=%q} %d\n", k.direction, k.result, m.connections[k])
+	}
+
+	fmt.Fprintln(w, "# HELP tailproxy_connection_duration_seconds Connection lifetime in seconds.")
+	fmt.Fprintln(w, "# TYPE tailproxy_connection_duration_seconds histogram")
+	m.duration.writeText(w, "tailproxy_connection_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP tailproxy_connection_bytes Bytes copied in + out over a connection.")
+	fmt.Fprintln(w, "# TYPE tailproxy_connection_bytes histogram")
+	m.bytesCopied.writeText(w, "tailproxy_connection_bytes")
+
+	fmt.Fprintln(w, "# HELP tailproxy_active_exports Exported ports currently advertised on the tailnet.")
+	fmt.Fprintln(w, "# TYPE tailproxy_active_exports gauge")
+	fmt.Fprintf(w, "tailproxy_active_exports %d\n", m.activeExports)
+}
+
+// histogram is a minimal fixed-bucket Prometheus-style histogram: each
+// bucket count is cumulative (observations <= the bucket's upper bound).
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []int64
+	sum     float64
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += v
+	h.count++
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) writeText(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, fmt.Sprintf("%g", b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
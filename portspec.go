@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// matchesPortSpec reports whether port is covered by spec, a comma-separated
+// list of single ports ("22,443") and/or inclusive ranges ("8000-8100").
+// Shared by ExporterManager's allow/deny lists and the per-user SOCKS5
+// port rules.
+func matchesPortSpec(port int, spec string) bool {
+	parts := strings.Split(spec, ",")
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+
+		if strings.Contains(part, "-") {
+			rangeParts := strings.Split(part, "-")
+			if len(rangeParts) != 2 {
+				continue
+			}
+			start, err1 := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
+			end, err2 := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
+			if err1 == nil && err2 == nil && port >= start && port <= end {
+				return true
+			}
+		} else {
+			p, err := strconv.Atoi(part)
+			if err == nil && p == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesHostSpec reports whether host is covered by spec, a comma-separated
+// list of shell-style globs ("*.example.com,internal.corp"). Mirrors
+// matchesPortSpec but for hostnames, used by the HTTP proxy's per-host
+// allow/deny list.
+func matchesHostSpec(host string, spec string) bool {
+	parts := strings.Split(spec, ",")
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if ok, err := path.Match(part, host); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/netip"
 	"os"
@@ -22,6 +23,20 @@ type ProxyServer struct {
 	server  *tsnet.Server
 	mu      sync.Mutex
 	dialer  *net.Dialer
+	creds   *CredentialStore
+	logger  *slog.Logger
+	metrics *Metrics
+
+	statsMu sync.Mutex
+	stats   map[string]*userStats // username -> accounting, "" for anonymous
+}
+
+// userStats tracks simple per-user connection accounting for the SOCKS5 and
+// HTTP proxy listeners.
+type userStats struct {
+	connections int64
+	bytesIn     int64
+	bytesOut    int64
 }
 
 func getStateDir(hostname string) string {
@@ -43,20 +58,28 @@ func getStateDir(hostname string) string {
 	return filepath.Join(stateHome, "tailproxy", hostname)
 }
 
-func NewProxyServer(config *Config) (*ProxyServer, error) {
+// NewProxyServer creates a ProxyServer. metrics may be nil, in which case
+// connection activity is not instrumented. levelVar, if non-nil, is the
+// *slog.LevelVar backing the logger, shared with other components (e.g.
+// ExporterManager) so a single SetLevel call adjusts logging everywhere; if
+// nil, a LevelVar private to this ProxyServer is created.
+func NewProxyServer(config *Config, metrics *Metrics, levelVar *slog.LevelVar) (*ProxyServer, error) {
 	// Create state directory - use persistent location for stable node ID
 	stateDir := getStateDir(config.Hostname)
 	if err := os.MkdirAll(stateDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create state directory: %w", err)
 	}
 
+	if levelVar == nil {
+		_, levelVar = newLogger(config)
+	}
+	logger := newLoggerForLevel(config, levelVar)
+
 	srv := &tsnet.Server{
 		Hostname: config.Hostname,
 		Dir:      stateDir,
-		Logf:     func(format string, args ...any) {
-			if config.Verbose {
-				log.Printf("[tsnet] "+format, args...)
-			}
+		Logf: func(format string, args ...any) {
+			logger.Debug(fmt.Sprintf(format, args...), "component", "tsnet")
 		},
 	}
 
@@ -64,18 +87,149 @@ func NewProxyServer(config *Config) (*ProxyServer, error) {
 		srv.AuthKey = config.AuthKey
 	}
 
+	creds, err := NewCredentialStore(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize credential store: %w", err)
+	}
+
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
 	return &ProxyServer{
-		config: config,
-		server: srv,
+		config:  config,
+		server:  srv,
+		creds:   creds,
+		logger:  logger,
+		metrics: metrics,
+		stats:   make(map[string]*userStats),
 	}, nil
 }
 
+// recordConnection updates connection accounting for user (empty string for
+// anonymous/unauthenticated access).
+func (p *ProxyServer) recordConnection(user string) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	st, ok := p.stats[user]
+	if !ok {
+		st = &userStats{}
+		p.stats[user] = st
+	}
+	st.connections++
+}
+
+// addBytes updates per-user byte accounting for a completed connection.
+func (p *ProxyServer) addBytes(user string, in, out int64) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	st, ok := p.stats[user]
+	if !ok {
+		st = &userStats{}
+		p.stats[user] = st
+	}
+	st.bytesIn += in
+	st.bytesOut += out
+}
+
+// UserStats is the JSON-serializable snapshot of one user's (or anonymous
+// access's, keyed by "") connection accounting, returned by Snapshot and
+// served from the admin /api/users endpoint.
+type UserStats struct {
+	User        string `json:"user"`
+	Connections int64  `json:"connections"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
+}
+
+// Snapshot returns the current connection accounting for every user (and
+// anonymous access, keyed by "") seen so far.
+func (p *ProxyServer) Snapshot() []UserStats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	out := make([]UserStats, 0, len(p.stats))
+	for user, st := range p.stats {
+		out = append(out, UserStats{
+			User:        user,
+			Connections: st.connections,
+			BytesIn:     st.bytesIn,
+			BytesOut:    st.bytesOut,
+		})
+	}
+	return out
+}
+
+// userAllowed reports whether user is permitted to proxy to port, per
+// Config.SOCKSUserRules. Users with no rule entry are allowed everywhere.
+func (p *ProxyServer) userAllowed(user string, port uint16) bool {
+	spec, ok := p.config.SOCKSUserRules[user]
+	if !ok || spec == "" {
+		return true
+	}
+	return matchesPortSpec(int(port), spec)
+}
+
+// TSNetServer returns the underlying tsnet.Server, for components (such as
+// ExporterManager) that share the same tailnet identity.
+func (p *ProxyServer) TSNetServer() *tsnet.Server {
+	return p.server
+}
+
+// setExitNode resolves exitNode (hostname, MagicDNS name, or IP) against the
+// current peer list and applies it via EditPrefs. It's shared between
+// startup and live SIGHUP/RELOAD reconfiguration.
+func setExitNode(ctx context.Context, lc *tailscale.LocalClient, exitNode string, logger *slog.Logger) error {
+	logger.Debug("configuring exit node", "exit_node", exitNode)
+
+	status, err := lc.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var exitNodeIP string
+	for _, peer := range status.Peer {
+		if peer.HostName == exitNode || peer.DNSName == exitNode ||
+			peer.DNSName == exitNode+"."+status.MagicDNSSuffix {
+			if len(peer.TailscaleIPs) > 0 {
+				exitNodeIP = peer.TailscaleIPs[0].String()
+				break
+			}
+		}
+		for _, ip := range peer.TailscaleIPs {
+			if ip.String() == exitNode {
+				exitNodeIP = ip.String()
+				break
+			}
+		}
+	}
+
+	if exitNodeIP == "" {
+		return fmt.Errorf("exit node %q not found in peers", exitNode)
+	}
+
+	logger.Debug("setting exit node", "exit_node", exitNode, "ip", exitNodeIP)
+
+	prefs := &ipn.MaskedPrefs{
+		Prefs: ipn.Prefs{
+			ExitNodeIP: netip.MustParseAddr(exitNodeIP),
+		},
+		ExitNodeIPSet: true,
+	}
+	if _, err := lc.EditPrefs(ctx, prefs); err != nil {
+		return fmt.Errorf("failed to set exit node: %w", err)
+	}
+
+	logger.Info("exit node configured", "exit_node", exitNode, "ip", exitNodeIP)
+	return nil
+}
+
 func (p *ProxyServer) waitForAuth(ctx context.Context, lc *tailscale.LocalClient) error {
 	// If we have an auth key, tsnet handles it automatically
 	if p.config.AuthKey != "" {
-		if p.config.Verbose {
-			log.Println("Using provided auth key...")
-		}
+		p.logger.Debug("using provided auth key")
 		// Wait for the server to be ready with the auth key
 		_, err := p.server.Up(ctx)
 		return err
@@ -99,9 +253,7 @@ func (p *ProxyServer) waitForAuth(ctx context.Context, lc *tailscale.LocalClient
 
 		// Check if we're already authenticated
 		if status.BackendState == "Running" {
-			if p.config.Verbose {
-				log.Println("Tailscale connected and authenticated")
-			}
+			p.logger.Debug("tailscale connected and authenticated")
 			return nil
 		}
 
@@ -130,9 +282,7 @@ func (p *ProxyServer) StartWithReady(ctx context.Context, ready chan<- struct{})
 	}
 
 	// Start tsnet
-	if p.config.Verbose {
-		log.Println("Starting Tailscale network...")
-	}
+	p.logger.Debug("starting tailscale network")
 
 	// Get local client to configure exit node
 	lc, err := p.server.LocalClient()
@@ -155,56 +305,8 @@ func (p *ProxyServer) StartWithReady(ctx context.Context, ready chan<- struct{})
 
 	// Set exit node if specified
 	if p.config.ExitNode != "" {
-		if p.config.Verbose {
-			log.Printf("Configuring exit node: %s", p.config.ExitNode)
-		}
-
-		// Get status to find the exit node peer
-		status, err := lc.Status(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get status: %w", err)
-		}
-
-		// Find the exit node by hostname or IP
-		var exitNodeIP string
-		for _, peer := range status.Peer {
-			if peer.HostName == p.config.ExitNode || peer.DNSName == p.config.ExitNode ||
-				peer.DNSName == p.config.ExitNode+"."+status.MagicDNSSuffix {
-				if len(peer.TailscaleIPs) > 0 {
-					exitNodeIP = peer.TailscaleIPs[0].String()
-					break
-				}
-			}
-			// Also check by IP address
-			for _, ip := range peer.TailscaleIPs {
-				if ip.String() == p.config.ExitNode {
-					exitNodeIP = ip.String()
-					break
-				}
-			}
-		}
-
-		if exitNodeIP == "" {
-			return fmt.Errorf("exit node %q not found in peers", p.config.ExitNode)
-		}
-
-		if p.config.Verbose {
-			log.Printf("Setting exit node to %s (IP: %s)", p.config.ExitNode, exitNodeIP)
-		}
-
-		// Set the exit node using EditPrefs
-		prefs := &ipn.MaskedPrefs{
-			Prefs: ipn.Prefs{
-				ExitNodeIP: netip.MustParseAddr(exitNodeIP),
-			},
-			ExitNodeIPSet: true,
-		}
-		if _, err := lc.EditPrefs(ctx, prefs); err != nil {
-			return fmt.Errorf("failed to set exit node: %w", err)
-		}
-
-		if p.config.Verbose {
-			log.Printf("Exit node configured successfully")
+		if err := setExitNode(ctx, lc, p.config.ExitNode, p.logger); err != nil {
+			return err
 		}
 	}
 
@@ -220,8 +322,12 @@ func (p *ProxyServer) StartWithReady(ctx context.Context, ready chan<- struct{})
 		listener.Close()
 	}()
 
-	if p.config.Verbose {
-		log.Printf("SOCKS5 proxy listening on 127.0.0.1:%d", p.config.ProxyPort)
+	p.logger.Info("SOCKS5 proxy listening", "addr", fmt.Sprintf("127.0.0.1:%d", p.config.ProxyPort))
+
+	if p.config.HTTPProxyPort != 0 {
+		if err := p.startHTTPProxy(ctx); err != nil {
+			return fmt.Errorf("failed to start HTTP proxy: %w", err)
+		}
 	}
 
 	// Signal that we're ready
@@ -236,9 +342,7 @@ func (p *ProxyServer) StartWithReady(ctx context.Context, ready chan<- struct{})
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
-			if p.config.Verbose {
-				log.Printf("Accept error: %v", err)
-			}
+			p.logger.Warn("accept error", "error", err)
 			continue
 		}
 
@@ -246,130 +350,252 @@ func (p *ProxyServer) StartWithReady(ctx context.Context, ready chan<- struct{})
 	}
 }
 
+const (
+	socksVerifyNoAuth       = 0x00
+	socksMethodUserPass     = 0x02
+	socksMethodNoAcceptable = 0xFF
+
+	socksCmdConnect      = 0x01
+	socksCmdBind         = 0x02
+	socksCmdUDPAssociate = 0x03
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksReplySucceeded            = 0x00
+	socksReplyGeneralFailure       = 0x01
+	socksReplyConnectionRefused    = 0x05
+	socksReplyCommandNotSupported  = 0x07
+	socksReplyAddrTypeNotSupported = 0x08
+)
+
 func (p *ProxyServer) handleConnection(ctx context.Context, clientConn net.Conn) {
 	defer clientConn.Close()
 
-	// SOCKS5 handshake
+	trace := newTraceID()
+	logger := p.logger.With("trace", trace, "peer", clientConn.RemoteAddr())
+
 	buf := make([]byte, 256)
 
-	// Read version and methods
-	n, err := clientConn.Read(buf)
-	if err != nil {
-		if p.config.Verbose {
-			log.Printf("Failed to read SOCKS5 greeting: %v", err)
-		}
+	// Greeting: VER NMETHODS METHODS...
+	n, err := io.ReadFull(clientConn, buf[:2])
+	if err != nil || n < 2 || buf[0] != 0x05 {
+		logger.Debug("invalid SOCKS5 greeting", "error", err)
+		return
+	}
+	nmethods := int(buf[1])
+	methods := make([]byte, nmethods)
+	if _, err := io.ReadFull(clientConn, methods); err != nil {
 		return
 	}
 
-	if n < 2 || buf[0] != 0x05 {
-		if p.config.Verbose {
-			log.Printf("Invalid SOCKS5 version: %d", buf[0])
+	requireAuth := p.creds.HasUsers()
+	method := byte(socksMethodNoAcceptable)
+	for _, m := range methods {
+		if requireAuth && m == socksMethodUserPass {
+			method = socksMethodUserPass
+			break
+		}
+		if !requireAuth && m == socksVerifyNoAuth {
+			method = socksVerifyNoAuth
+			break
 		}
-		return
 	}
 
-	// Send "no authentication required" response
-	_, err = clientConn.Write([]byte{0x05, 0x00})
-	if err != nil {
+	if _, err := clientConn.Write([]byte{0x05, method}); err != nil {
 		return
 	}
+	if method == socksMethodNoAcceptable {
+		logger.Debug("no acceptable SOCKS5 auth method offered by client")
+		return
+	}
+
+	var user string
+	if method == socksMethodUserPass {
+		var ok bool
+		user, ok = p.authenticateUserPass(logger, clientConn)
+		if !ok {
+			return
+		}
+		logger = logger.With("user", user)
+	}
 
-	// Read request
+	p.recordConnection(user)
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
 	n, err = clientConn.Read(buf)
 	if err != nil {
-		if p.config.Verbose {
-			log.Printf("Failed to read SOCKS5 request: %v", err)
-		}
+		logger.Debug("failed to read SOCKS5 request", "error", err)
 		return
 	}
-
 	if n < 7 || buf[0] != 0x05 {
 		return
 	}
 
 	cmd := buf[1]
-	if cmd != 0x01 { // Only support CONNECT
-		clientConn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	host, port, _, ok := parseSOCKSAddr(buf[3:n])
+	if !ok {
+		clientConn.Write(socksReply(socksReplyAddrTypeNotSupported, nil))
 		return
 	}
 
-	// Parse address
-	addrType := buf[3]
-	var host string
-	var port uint16
+	// UDP ASSOCIATE's address is only the client's proposed relay source;
+	// its traffic is checked per-datagram in handleUDPDatagram instead.
+	if cmd != socksCmdUDPAssociate && !p.userAllowed(user, port) {
+		logger.Warn("user denied access to port by policy", "port", port)
+		p.metrics.RecordConnection("socks5", "denied")
+		clientConn.Write(socksReply(socksReplyConnectionRefused, nil))
+		return
+	}
 
-	switch addrType {
-	case 0x01: // IPv4
-		if n < 10 {
-			return
+	switch cmd {
+	case socksCmdConnect:
+		p.handleConnect(ctx, logger, clientConn, user, host, port)
+	case socksCmdBind:
+		p.handleBind(ctx, clientConn, host, port)
+	case socksCmdUDPAssociate:
+		p.handleUDPAssociate(ctx, clientConn, user)
+	default:
+		clientConn.Write(socksReply(socksReplyCommandNotSupported, nil))
+	}
+}
+
+// authenticateUserPass performs the RFC 1929 USERNAME/PASSWORD
+// subnegotiation and returns the authenticated username.
+func (p *ProxyServer) authenticateUserPass(logger *slog.Logger, conn net.Conn) (string, bool) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil || hdr[0] != 0x01 {
+		return "", false
+	}
+
+	ulen := int(hdr[1])
+	ubuf := make([]byte, ulen)
+	if _, err := io.ReadFull(conn, ubuf); err != nil {
+		return "", false
+	}
+
+	plenBuf := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plenBuf); err != nil {
+		return "", false
+	}
+	pbuf := make([]byte, int(plenBuf[0]))
+	if _, err := io.ReadFull(conn, pbuf); err != nil {
+		return "", false
+	}
+
+	user, pass := string(ubuf), string(pbuf)
+	if p.creds.Authenticate(user, pass) {
+		conn.Write([]byte{0x01, 0x00})
+		return user, true
+	}
+
+	conn.Write([]byte{0x01, 0x01})
+	logger.Warn("SOCKS5 authentication failed", "user", user)
+	return "", false
+}
+
+// parseSOCKSAddr parses an ATYP DST.ADDR DST.PORT field and returns the host,
+// port, number of bytes consumed from b, and whether parsing succeeded.
+// consumed must be used to locate whatever follows (e.g. a UDP datagram's
+// payload) instead of re-deriving the address length separately, since a
+// domain name's length is data-dependent.
+func parseSOCKSAddr(b []byte) (host string, port uint16, consumed int, ok bool) {
+	if len(b) < 1 {
+		return "", 0, 0, false
+	}
+	switch b[0] {
+	case socksAddrIPv4:
+		if len(b) < 7 {
+			return "", 0, 0, false
 		}
-		host = fmt.Sprintf("%d.%d.%d.%d", buf[4], buf[5], buf[6], buf[7])
-		port = uint16(buf[8])<<8 | uint16(buf[9])
-	case 0x03: // Domain name
-		if n < 5 {
-			return
+		host := fmt.Sprintf("%d.%d.%d.%d", b[1], b[2], b[3], b[4])
+		port := uint16(b[5])<<8 | uint16(b[6])
+		return host, port, 7, true
+	case socksAddrDomain:
+		if len(b) < 2 {
+			return "", 0, 0, false
 		}
-		addrLen := int(buf[4])
-		if n < 5+addrLen+2 {
-			return
+		addrLen := int(b[1])
+		if len(b) < 2+addrLen+2 {
+			return "", 0, 0, false
 		}
-		host = string(buf[5 : 5+addrLen])
-		port = uint16(buf[5+addrLen])<<8 | uint16(buf[5+addrLen+1])
-	case 0x04: // IPv6
-		if n < 22 {
-			return
+		host := string(b[2 : 2+addrLen])
+		port := uint16(b[2+addrLen])<<8 | uint16(b[2+addrLen+1])
+		return host, port, 2 + addrLen + 2, true
+	case socksAddrIPv6:
+		if len(b) < 19 {
+			return "", 0, 0, false
 		}
-		host = net.IP(buf[4:20]).String()
-		port = uint16(buf[20])<<8 | uint16(buf[21])
+		host := net.IP(b[1:17]).String()
+		port := uint16(b[17])<<8 | uint16(b[18])
+		return host, port, 19, true
 	default:
-		clientConn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
-		return
+		return "", 0, 0, false
 	}
+}
 
-	target := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-
-	if p.config.Verbose {
-		log.Printf("Connecting to %s via Tailscale", target)
+// socksReply builds a SOCKS5 reply frame for the given status. addr, if
+// non-nil, is used as the BND.ADDR/BND.PORT; otherwise a zero IPv4 address
+// is returned, which is acceptable for error replies.
+func socksReply(status byte, addr *net.TCPAddr) []byte {
+	if addr == nil {
+		return []byte{0x05, status, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0}
 	}
 
-	// Dial through Tailscale
-	var remoteConn net.Conn
-	if p.config.ExitNode != "" {
-		// Use tsnet's dialer which routes through the Tailscale network
-		remoteConn, err = p.server.Dial(ctx, "tcp", target)
+	ip4 := addr.IP.To4()
+	reply := []byte{0x05, status, 0x00}
+	if ip4 != nil {
+		reply = append(reply, socksAddrIPv4)
+		reply = append(reply, ip4...)
 	} else {
-		// Direct connection through Tailscale network
-		remoteConn, err = p.server.Dial(ctx, "tcp", target)
+		reply = append(reply, socksAddrIPv6)
+		reply = append(reply, addr.IP.To16()...)
 	}
+	reply = append(reply, byte(addr.Port>>8), byte(addr.Port))
+	return reply
+}
+
+func (p *ProxyServer) handleConnect(ctx context.Context, logger *slog.Logger, clientConn net.Conn, user string, host string, port uint16) {
+	target := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	logger = logger.With("target", target)
+
+	logger.Debug("connecting via tailscale")
 
+	start := time.Now()
+	remoteConn, err := p.server.Dial(ctx, "tcp", target)
 	if err != nil {
-		if p.config.Verbose {
-			log.Printf("Failed to connect to %s: %v", target, err)
-		}
-		clientConn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		logger.Warn("failed to connect", "error", err)
+		p.metrics.RecordConnection("socks5", "error")
+		clientConn.Write(socksReply(socksReplyConnectionRefused, nil))
 		return
 	}
 	defer remoteConn.Close()
 
-	// Send success response
-	_, err = clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
-	if err != nil {
+	if _, err := clientConn.Write(socksReply(socksReplySucceeded, nil)); err != nil {
 		return
 	}
 
-	// Bidirectional copy
 	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		io.Copy(remoteConn, clientConn)
+		bytesIn, _ = io.Copy(remoteConn, clientConn)
 	}()
 
 	go func() {
 		defer wg.Done()
-		io.Copy(clientConn, remoteConn)
+		bytesOut, _ = io.Copy(clientConn, remoteConn)
 	}()
 
 	wg.Wait()
+
+	p.metrics.RecordConnection("socks5", "ok")
+	p.metrics.ObserveConnection(time.Since(start).Seconds(), bytesIn, bytesOut)
+	p.addBytes(user, bytesIn, bytesOut)
+
+	logger.Debug("connection closed",
+		"bytes_in", bytesIn, "bytes_out", bytesOut, "duration", time.Since(start))
 }
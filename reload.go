@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// ApplyConfig diffs newConfig against the live configuration and applies the
+// changes in place: switching exit node, adjusting the export allow/deny
+// lists and re-checking already-active exporters against them, and updating
+// simple runtime knobs (Verbose, LogLevel, ExportMax, AuthKey). Other fields
+// of newConfig, such as HealthChecks, the Export* authorization settings,
+// the SOCKS/HTTP proxy settings and LogFormat, are not applied. Used by both
+// the control socket's RELOAD command and the SIGHUP handler in main.
+func (em *ExporterManager) ApplyConfig(ctx context.Context, newConfig *Config) error {
+	if newConfig.ExitNode != "" && newConfig.ExitNode != em.config.ExitNode {
+		lc, err := em.server.LocalClient()
+		if err != nil {
+			return fmt.Errorf("failed to get local client: %w", err)
+		}
+		if err := setExitNode(ctx, lc, newConfig.ExitNode, em.logger); err != nil {
+			return fmt.Errorf("failed to switch exit node: %w", err)
+		}
+	}
+
+	em.mu.Lock()
+	em.config.ExitNode = newConfig.ExitNode
+	em.config.ExportAllowPorts = newConfig.ExportAllowPorts
+	em.config.ExportDenyPorts = newConfig.ExportDenyPorts
+	em.config.ExportMax = newConfig.ExportMax
+	em.config.Verbose = newConfig.Verbose
+	em.config.LogLevel = newConfig.LogLevel
+	if newConfig.AuthKey != "" {
+		em.config.AuthKey = newConfig.AuthKey // persisted for next restart; tsnet auth keys can't rotate live
+	}
+	em.logLevel.Set(resolveLogLevel(em.config))
+
+	var toStop []int
+	for port := range em.exporters {
+		if !em.isPortAllowed(port) {
+			toStop = append(toStop, port)
+		}
+	}
+	for _, port := range toStop {
+		em.logger.Info("port no longer allowed by reloaded export policy, stopping", "port", port)
+		// em.desired is left untouched (same as stopExporter's own
+		// contract) so a later policy widen, below, can find and reopen it.
+		em.stopExporter(port)
+	}
+
+	// A widened allow list may newly permit ports that were LISTEN'd but
+	// denied at the time, and are still sitting in em.desired with no
+	// active exporter. Retry them now, the same way reconcileOnce retries a
+	// port once its health check recovers.
+	var toStart []int
+	for port, count := range em.desired {
+		if count <= 0 {
+			continue
+		}
+		if _, active := em.exporters[port]; active {
+			continue
+		}
+		if em.isPortAllowed(port) {
+			toStart = append(toStart, port)
+		}
+	}
+	for _, port := range toStart {
+		if len(em.exporters) >= em.config.ExportMax {
+			em.logger.Warn("cannot resume export, max exports reached", "port", port, "max", em.config.ExportMax)
+			break
+		}
+		if hc := resolveHealthCheck(em.config, port); hc != nil && !checkHealth(port, hc) {
+			em.logger.Debug("export target not healthy yet, deferring export", "port", port)
+			continue
+		}
+		if err := em.startExporter(port); err != nil {
+			em.logger.Warn("failed to resume export after policy widen", "port", port, "error", err)
+			continue
+		}
+		em.logger.Info("export policy widened, resuming export", "port", port)
+	}
+	em.mu.Unlock()
+
+	return nil
+}
+
+// reloadFromDisk re-reads the config file at em.configPath and applies it.
+// Used by the control socket's RELOAD command and SIGHUP.
+func (em *ExporterManager) reloadFromDisk(ctx context.Context) error {
+	if em.configPath == "" {
+		return fmt.Errorf("no config file in use, nothing to reload")
+	}
+
+	newConfig, err := LoadConfig(em.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return em.ApplyConfig(ctx, newConfig)
+}
+
+// setField applies a SET command for one of the reloadable keys, persisting
+// the change to disk when a config file is in use.
+func (em *ExporterManager) setField(ctx context.Context, key, value string) error {
+	em.mu.Lock()
+	cfg := *em.config // shallow copy to diff against
+	em.mu.Unlock()
+
+	switch key {
+	case "ExportAllowPorts":
+		cfg.ExportAllowPorts = value
+	case "ExportDenyPorts":
+		cfg.ExportDenyPorts = value
+	case "ExitNode":
+		cfg.ExitNode = value
+	case "Verbose":
+		cfg.Verbose = value == "true" || value == "1"
+	case "LogLevel":
+		cfg.LogLevel = value
+	case "ExportMax":
+		var n int
+		if _, err := fmt.Sscanf(value, "%d", &n); err != nil || n <= 0 {
+			return fmt.Errorf("invalid ExportMax value %q", value)
+		}
+		cfg.ExportMax = n
+	default:
+		return fmt.Errorf("unknown or read-only key %q", key)
+	}
+
+	if err := em.ApplyConfig(ctx, &cfg); err != nil {
+		return err
+	}
+
+	if em.configPath != "" {
+		if err := em.config.Save(em.configPath); err != nil {
+			return fmt.Errorf("applied but failed to persist config: %w", err)
+		}
+	}
+	return nil
+}
+
+// getField reads back the current value of one of the reloadable config keys
+// that setField accepts; any other key is an error.
+func (em *ExporterManager) getField(key string) (string, error) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	switch key {
+	case "ExportAllowPorts":
+		return em.config.ExportAllowPorts, nil
+	case "ExportDenyPorts":
+		return em.config.ExportDenyPorts, nil
+	case "ExitNode":
+		return em.config.ExitNode, nil
+	case "Verbose":
+		return fmt.Sprintf("%t", em.config.Verbose), nil
+	case "LogLevel":
+		return em.config.LogLevel, nil
+	case "ExportMax":
+		return fmt.Sprintf("%d", em.config.ExportMax), nil
+	default:
+		return "", fmt.Errorf("unknown key %q", key)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// handleBind implements the SOCKS5 BIND command for FTP-style callbacks: it
+// opens a tailnet listener, reports its address back to the client, waits
+// for a single inbound connection, reports the peer's address, and then
+// relays bytes between the client and that connection.
+func (p *ProxyServer) handleBind(ctx context.Context, clientConn net.Conn, host string, port uint16) {
+	trace := newTraceID()
+	logger := p.logger.With("trace", trace)
+
+	listener, err := p.server.Listen("tcp", ":0")
+	if err != nil {
+		logger.Warn("BIND: failed to open tailnet listener", "error", err)
+		clientConn.Write(socksReply(socksReplyGeneralFailure, nil))
+		return
+	}
+	defer listener.Close()
+
+	bindAddr, _ := listener.Addr().(*net.TCPAddr)
+	if _, err := clientConn.Write(socksReply(socksReplySucceeded, bindAddr)); err != nil {
+		return
+	}
+
+	logger.Debug("BIND: listening, awaiting callback connection", "addr", listener.Addr())
+
+	acceptCh := make(chan net.Conn, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		acceptCh <- conn
+	}()
+
+	var peerConn net.Conn
+	select {
+	case <-ctx.Done():
+		return
+	case err := <-errCh:
+		logger.Warn("BIND: accept failed", "error", err)
+		clientConn.Write(socksReply(socksReplyGeneralFailure, nil))
+		return
+	case peerConn = <-acceptCh:
+	}
+	defer peerConn.Close()
+
+	peerAddr, _ := peerConn.RemoteAddr().(*net.TCPAddr)
+	if _, err := clientConn.Write(socksReply(socksReplySucceeded, peerAddr)); err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(peerConn, clientConn)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(clientConn, peerConn)
+	}()
+	wg.Wait()
+}
+
+// udpAssociation tracks the state of a single UDP ASSOCIATE session: the
+// loopback relay socket facing the client, and the per-destination tsnet
+// connections used to actually send/receive datagrams over the tailnet.
+type udpAssociation struct {
+	relay      *net.UDPConn
+	clientAddr *net.UDPAddr
+	clientMu   sync.Mutex
+	user       string // authenticated user, "" for anonymous; checked per-datagram
+
+	mu    sync.Mutex
+	conns map[string]net.Conn // destination host:port -> tsnet UDP conn
+}
+
+// handleUDPAssociate implements the SOCKS5 UDP ASSOCIATE command. Per RFC
+// 1928 the association lives as long as the TCP control connection stays
+// open, so we hold clientConn open (discarding any bytes it sends) while the
+// UDP relay runs, and tear everything down when it closes. user is checked
+// against Config.SOCKSUserRules per-datagram in handleUDPDatagram, since the
+// destination here is only the client's proposed relay source, not the
+// eventual traffic.
+func (p *ProxyServer) handleUDPAssociate(ctx context.Context, clientConn net.Conn, user string) {
+	trace := newTraceID()
+	logger := p.logger.With("trace", trace, "user", user)
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		logger.Warn("UDP ASSOCIATE: failed to open relay socket", "error", err)
+		clientConn.Write(socksReply(socksReplyGeneralFailure, nil))
+		return
+	}
+	defer relay.Close()
+
+	assoc := &udpAssociation{
+		relay: relay,
+		conns: make(map[string]net.Conn),
+		user:  user,
+	}
+
+	relayAddr, _ := relay.LocalAddr().(*net.UDPAddr)
+	if _, err := clientConn.Write(socksReply(socksReplySucceeded, &net.TCPAddr{IP: relayAddr.IP, Port: relayAddr.Port})); err != nil {
+		return
+	}
+
+	logger.Debug("UDP ASSOCIATE: relay listening", "addr", relayAddr)
+
+	relayCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go p.udpRelayLoop(relayCtx, logger, assoc)
+
+	// The association stays alive only while the control connection is
+	// open; block reading from it until it errors out or ctx is canceled.
+	buf := make([]byte, 1)
+	for {
+		clientConn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := clientConn.Read(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				select {
+				case <-relayCtx.Done():
+					return
+				default:
+					continue
+				}
+			}
+			return
+		}
+	}
+}
+
+func (p *ProxyServer) udpRelayLoop(ctx context.Context, logger *slog.Logger, assoc *udpAssociation) {
+	buf := make([]byte, 65536)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		assoc.relay.SetReadDeadline(time.Now().Add(time.Second))
+		n, from, err := assoc.relay.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		// Remember the client's source address so replies can be routed back.
+		assoc.clientMu.Lock()
+		assoc.clientAddr = from
+		assoc.clientMu.Unlock()
+
+		p.handleUDPDatagram(ctx, logger, assoc, buf[:n])
+	}
+}
+
+// handleUDPDatagram decapsulates a single SOCKS5 UDP request (RSV RSV FRAG
+// ATYP DST.ADDR DST.PORT DATA), forwards the payload to its destination over
+// the tailnet, and starts a reader goroutine for the reply path if this is a
+// destination we haven't seen yet on this association.
+func (p *ProxyServer) handleUDPDatagram(ctx context.Context, logger *slog.Logger, assoc *udpAssociation, datagram []byte) {
+	if len(datagram) < 4 {
+		return
+	}
+	if datagram[2] != 0x00 {
+		// Fragmentation is not supported; drop fragmented datagrams.
+		return
+	}
+
+	host, port, addrLen, ok := parseSOCKSAddr(datagram[3:])
+	if !ok {
+		return
+	}
+	if !p.userAllowed(assoc.user, port) {
+		logger.Warn("UDP ASSOCIATE: dropping datagram, user denied access to port by policy", "user", assoc.user, "dest_port", port)
+		return
+	}
+	payload := datagram[3+addrLen:]
+	dest := net.JoinHostPort(host, strconv.Itoa(int(port)))
+
+	assoc.mu.Lock()
+	conn, exists := assoc.conns[dest]
+	assoc.mu.Unlock()
+
+	if !exists {
+		var err error
+		conn, err = p.server.Dial(ctx, "udp", dest)
+		if err != nil {
+			logger.Warn("UDP ASSOCIATE: failed to dial destination", "dest", dest, "error", err)
+			return
+		}
+
+		assoc.mu.Lock()
+		assoc.conns[dest] = conn
+		assoc.mu.Unlock()
+
+		go p.udpReplyLoop(ctx, assoc, conn, host, port)
+	}
+
+	conn.Write(payload)
+}
+
+// udpReplyLoop reads datagrams coming back from a tailnet destination,
+// re-encapsulates them with a SOCKS5 UDP header, and sends them to the
+// client's relay source address.
+func (p *ProxyServer) udpReplyLoop(ctx context.Context, assoc *udpAssociation, conn net.Conn, host string, port uint16) {
+	defer conn.Close()
+	buf := make([]byte, 65536)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		assoc.clientMu.Lock()
+		clientAddr := assoc.clientAddr
+		assoc.clientMu.Unlock()
+		if clientAddr == nil {
+			continue
+		}
+
+		header := encodeSOCKSUDPHeader(host, port)
+		assoc.relay.WriteToUDP(append(header, buf[:n]...), clientAddr)
+	}
+}
+
+// encodeSOCKSUDPHeader builds the RSV RSV FRAG ATYP DST.ADDR DST.PORT
+// prefix for a SOCKS5 UDP reply datagram.
+func encodeSOCKSUDPHeader(host string, port uint16) []byte {
+	ip := net.ParseIP(host)
+	header := []byte{0x00, 0x00, 0x00}
+	if ip4 := ip.To4(); ip != nil && ip4 != nil {
+		header = append(header, socksAddrIPv4)
+		header = append(header, ip4...)
+	} else if ip != nil {
+		header = append(header, socksAddrIPv6)
+		header = append(header, ip.To16()...)
+	} else {
+		header = append(header, socksAddrDomain, byte(len(host)))
+		header = append(header, host...)
+	}
+	header = append(header, byte(port>>8), byte(port))
+	return header
+}